@@ -5,19 +5,22 @@ import (
 	"encoding/base64"
 	"fmt"
 	"os"
+	"sort"
 	"strings"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/acm"
 	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
-	"github.com/aws/aws-sdk-go/service/iam"
 	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/aws/aws-sdk-go/service/route53"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/hashicorp/go-hclog"
 	"github.com/mattn/go-isatty"
 	"github.com/mitchellh/devflow/builtin/lambda/runner"
+	"github.com/mitchellh/devflow/builtin/lambda/stack"
 	"github.com/mitchellh/devflow/internal/pkg/status"
 	"github.com/mitchellh/devflow/sdk/component"
 	"github.com/pkg/errors"
@@ -31,6 +34,65 @@ const (
 
 type DeployConfig struct {
 	Bucket string `hcl:"bucket"`
+
+	// HTTP, when set, fronts the deployed function with an API Gateway
+	// v2 HTTP API so the app can be reached like a normal web service.
+	HTTP *HTTPConfig `hcl:"http,block"`
+
+	// Domain, when set, binds a custom domain name to the HTTP API.
+	// Requires HTTP to also be set.
+	Domain *DomainConfig `hcl:"domain,block"`
+
+	// Traffic, when set, shifts a percentage of traffic to each newly
+	// deployed version instead of cutting over immediately.
+	Traffic *TrafficConfig `hcl:"traffic,block"`
+
+	// Retries overrides the default retry policy applied to mutating
+	// AWS calls made during deploy.
+	Retries []RetryRule `hcl:"retry,block"`
+}
+
+// DomainConfig configures the custom domain that's mapped to the HTTP API.
+type DomainConfig struct {
+	// Name is the fully qualified domain name to serve the app on.
+	Name string `hcl:"name"`
+
+	// ZoneId is the Route53 hosted zone to manage records in. If empty,
+	// it's auto-discovered from Name by longest suffix match.
+	ZoneId string `hcl:"zone_id,optional"`
+
+	// CertArn is an existing ACM certificate to use. If empty, one is
+	// requested (in us-east-1, via DNS validation) and managed for you.
+	CertArn string `hcl:"cert_arn,optional"`
+}
+
+// HTTPConfig configures the API Gateway HTTP API that's created in front
+// of the Lambda function.
+type HTTPConfig struct {
+	// Path is the route path to wire to the function. When empty, the API's
+	// "$default" route is used so every request is forwarded.
+	Path string `hcl:"path,optional"`
+
+	// Stage is the API Gateway stage name to deploy to. Defaults to "$default".
+	Stage string `hcl:"stage,optional"`
+
+	// Timeout is the integration timeout, in milliseconds. Defaults to
+	// API Gateway's own default (29000ms) when zero.
+	Timeout int64 `hcl:"timeout,optional"`
+}
+
+func (c *HTTPConfig) stage() string {
+	if c.Stage == "" {
+		return "$default"
+	}
+	return c.Stage
+}
+
+func (c *HTTPConfig) routeKey() string {
+	if c.Path == "" {
+		return "$default"
+	}
+	return "ANY " + c.Path
 }
 
 type Deployer struct {
@@ -43,9 +105,6 @@ type Deployer struct {
 	// Runtime    string
 	// ScratchDir string
 	// Bucket     string
-
-	roleName string
-	roleArn  string
 }
 
 func (d *Deployer) Config() (interface{}, error) {
@@ -64,18 +123,11 @@ func NewDeployer() *Deployer {
 	return &Deployer{}
 }
 
-const rolePolicy = `{
-  "Version": "2012-10-17",
-  "Statement": [
-    {
-      "Effect": "Allow",
-      "Principal": {
-        "Service": "lambda.amazonaws.com"
-      },
-      "Action": "sts:AssumeRole"
-    }
-  ]
-}`
+// roleName is the IAM role name used for every app's function, derived
+// the same way the stack template names the role resource.
+func roleName(appName string) string {
+	return "lambda-" + appName
+}
 
 var ignorePrefixes = []string{
 	"etc/", "input/", "root/", "run/", "tmp/", "usr/include/", "usr/share/doc/",
@@ -102,55 +154,16 @@ var shiftPrefix = []prefix{
 
 var sess = session.New(aws.NewConfig().WithRegion("us-west-2"))
 
-func (d *Deployer) SetupRole(L hclog.Logger, app *component.Source) error {
-	svc := iam.New(sess)
-
-	d.roleName = "lambda-" + app.App
-
-	L.Info("attempting to retrieve existing role", "role-name", d.roleName)
-
-	queryInput := &iam.GetRoleInput{
-		RoleName: aws.String(d.roleName),
-	}
-
-	getOut, err := svc.GetRole(queryInput)
-	if err == nil {
-		d.roleArn = *getOut.Role.Arn
-		L.Info("found existing role", "arn", d.roleArn)
-		return nil
-	}
-
-	L.Info("creating new role")
+// sessUsEast1 is used for ACM calls, which the console/CLI convention also
+// requires to live in us-east-1 regardless of where the app itself runs.
+var sessUsEast1 = session.New(aws.NewConfig().WithRegion("us-east-1"))
 
-	input := &iam.CreateRoleInput{
-		AssumeRolePolicyDocument: aws.String(rolePolicy),
-		Path:                     aws.String("/"),
-		RoleName:                 aws.String(d.roleName),
-	}
-
-	result, err := svc.CreateRole(input)
-	if err != nil {
-		return err
-	}
-
-	d.roleArn = *result.Role.Arn
-
-	L.Info("created new role", "arn", d.roleArn)
-
-	aInput := &iam.AttachRolePolicyInput{
-		RoleName:  aws.String(d.roleName),
-		PolicyArn: aws.String("arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole"),
-	}
-
-	_, err = svc.AttachRolePolicy(aInput)
-	if err != nil {
-		return err
-	}
-
-	L.Info("attached execution role policy")
-
-	return nil
-}
+// certPollInterval and certPollTimeout bound how long configureDomain will
+// wait for a freshly requested ACM certificate to validate and issue.
+const (
+	certPollInterval = 10 * time.Second
+	certPollTimeout  = 10 * time.Minute
+)
 
 func LambdaCodeSha256(path string) (string, error) {
 	sumRaw, err := HashFile(path)
@@ -217,24 +230,33 @@ func (d *Deployer) CreateLayer(L hclog.Logger, app *component.Source, info *AppI
 	if err == nil {
 		L.Info("reusing existing key", "etag", *headOut.ETag)
 	} else {
-		_, err = uploader.Upload(&s3manager.UploadInput{
-			Body:   f,
-			Bucket: aws.String(d.config.Bucket),
-			Key:    aws.String(layerName),
+		err = withRetry(L, d.retries(), func() error {
+			_, err := uploader.Upload(&s3manager.UploadInput{
+				Body:   f,
+				Bucket: aws.String(d.config.Bucket),
+				Key:    aws.String(layerName),
+			})
+			return err
 		})
 		if err != nil {
-			return "", nil
+			return "", errors.Wrapf(err, "uploading layer: %s", path)
 		}
 	}
 
-	pubOut, err := lamSvc.PublishLayerVersion(&lambda.PublishLayerVersionInput{
-		Description:        aws.String(fmt.Sprintf("devflow app %s - %s", app.App, info.BuildId)),
-		LayerName:          aws.String(name),
-		CompatibleRuntimes: []*string{aws.String(info.Runtime)},
-		Content: &lambda.LayerVersionContentInput{
-			S3Bucket: aws.String(d.config.Bucket),
-			S3Key:    aws.String(layerName),
-		},
+	var pubOut *lambda.PublishLayerVersionOutput
+
+	err = withRetry(L, d.retries(), func() error {
+		var err error
+		pubOut, err = lamSvc.PublishLayerVersion(&lambda.PublishLayerVersionInput{
+			Description:        aws.String(fmt.Sprintf("devflow app %s - %s", app.App, info.BuildId)),
+			LayerName:          aws.String(name),
+			CompatibleRuntimes: []*string{aws.String(info.Runtime)},
+			Content: &lambda.LayerVersionContentInput{
+				S3Bucket: aws.String(d.config.Bucket),
+				S3Key:    aws.String(layerName),
+			},
+		})
+		return err
 	})
 
 	if err != nil {
@@ -254,9 +276,17 @@ func (d *Deployer) CreatePreLayer(L hclog.Logger, app *component.Source, info *A
 	return d.CreateLayer(L, app, info, fmt.Sprintf("%s-pre", app.App), path)
 }
 
-func (d *Deployer) CreateFunction(L hclog.Logger, app *component.Source, info *AppInfo) (string, error) {
-	lamSvc := lambda.New(sess)
+// CreateShimLayer publishes the API Gateway proxy shim (built alongside
+// the app and referenced by info.ShimZip) as its own layer so HTTP-enabled
+// deploys don't need to bundle it into every app zip.
+func (d *Deployer) CreateShimLayer(L hclog.Logger, app *component.Source, info *AppInfo) (string, error) {
+	return d.CreateLayer(L, app, info, fmt.Sprintf("%s-shim", app.App), info.ShimZip)
+}
 
+// uploadAppZip uploads the app's deployment package to S3 and returns the
+// key it was stored under. The stack template references this key
+// directly; CloudFormation has no way to upload code itself.
+func (d *Deployer) uploadAppZip(L hclog.Logger, app *component.Source, info *AppInfo) (string, error) {
 	uploader := s3manager.NewUploader(sess)
 
 	f, err := os.Open(info.AppZip)
@@ -271,125 +301,240 @@ func (d *Deployer) CreateFunction(L hclog.Logger, app *component.Source, info *A
 		return "", err
 	}
 
-	layerName := fmt.Sprintf("%s-%s-app.zip", app.App, info.BuildId)
+	key := fmt.Sprintf("%s-%s-app.zip", app.App, info.BuildId)
 
-	L.Info("uploading app", "size", stat.Size(), "bucket", d.config.Bucket, "key", layerName)
+	L.Info("uploading app", "size", stat.Size(), "bucket", d.config.Bucket, "key", key)
 
-	_, err = uploader.Upload(&s3manager.UploadInput{
-		Body:   f,
-		Bucket: aws.String(d.config.Bucket),
-		Key:    aws.String(layerName),
+	err = withRetry(L, d.retries(), func() error {
+		_, err := uploader.Upload(&s3manager.UploadInput{
+			Body:   f,
+			Bucket: aws.String(d.config.Bucket),
+			Key:    aws.String(key),
+		})
+		return err
 	})
 	if err != nil {
 		return "", err
 	}
 
-	preLayer, err := d.CreatePreLayer(L, app, info, info.PreZip)
+	return key, nil
+}
+
+// addHTTPAPI adds the HTTP API, its integration/route/stage, and the
+// permission letting it invoke the function alias, to tmpl. aliasArn is
+// the alias's ARN, already resolved by shiftTraffic.
+func (d *Deployer) addHTTPAPI(tmpl *stack.Template, app *component.Source, aliasArn string) string {
+	cfg := d.config.HTTP
+
+	apiId := tmpl.AddHttpApi("Api", "Integration", "Route", "Stage",
+		app.App, cfg.routeKey(), cfg.stage(), aliasArn, cfg.Timeout)
+
+	executeApiArn := map[string]interface{}{
+		"Fn::Sub": "arn:aws:execute-api:${AWS::Region}:${AWS::AccountId}:${" + apiId + "}/*/*",
+	}
+
+	tmpl.AddInvokePermission("ApiInvokePermission", aliasArn, "apigateway.amazonaws.com", executeApiArn)
+
+	return apiId
+}
+
+// addDomain provisions (or reuses) an ACM certificate and a Route53
+// hosted zone for the configured domain outside the stack, then adds the
+// API Gateway custom domain, mapping, and alias DNS record to tmpl.
+func (d *Deployer) addDomain(L hclog.Logger, tmpl *stack.Template, app *component.Source, apiLogicalId string) error {
+	cfg := d.config.Domain
+
+	zoneId := cfg.ZoneId
+	if zoneId == "" {
+		var err error
+		zoneId, err = d.findHostedZone(cfg.Name)
+		if err != nil {
+			return errors.Wrap(err, "discovering hosted zone")
+		}
+	}
+
+	certArn := cfg.CertArn
+	if certArn == "" {
+		var err error
+		certArn, err = d.ensureCertificate(L, app, cfg.Name, zoneId)
+		if err != nil {
+			return errors.Wrap(err, "provisioning ACM certificate")
+		}
+	}
+
+	tmpl.AddDomain("Domain", "ApiMapping", "DomainRecord", cfg.Name, certArn, apiLogicalId, d.config.HTTP.stage(), zoneId)
+
+	return nil
+}
+
+// ensureCertificate reuses an already-issued ACM certificate for name
+// tagged for this app, if one exists; otherwise it requests a new
+// DNS-validated certificate (in us-east-1), writes the validation CNAME
+// into zoneId, and blocks until it's ISSUED. Reusing is what makes
+// Deploy idempotent here: without it, every deploy would request (and
+// wait up to certPollTimeout for) a brand-new certificate.
+func (d *Deployer) ensureCertificate(L hclog.Logger, app *component.Source, name, zoneId string) (string, error) {
+	svc := acm.New(sessUsEast1)
+
+	existing, err := d.findIssuedCertificate(svc, app, name)
 	if err != nil {
-		return "", err
+		return "", errors.Wrap(err, "looking for an existing certificate")
 	}
 
-	libLayer, err := d.CreateLibraryLayer(L, app, info, info.LibZip)
+	if existing != "" {
+		L.Info("reusing existing ACM certificate", "arn", existing)
+		return existing, nil
+	}
+
+	out, err := svc.RequestCertificate(&acm.RequestCertificateInput{
+		DomainName:       aws.String(name),
+		ValidationMethod: aws.String("DNS"),
+		Tags: []*acm.Tag{
+			{Key: aws.String("devflow.app"), Value: aws.String(app.App)},
+		},
+	})
 	if err != nil {
 		return "", err
 	}
 
-	fnInfo, err := lamSvc.GetFunction(&lambda.GetFunctionInput{
-		FunctionName: aws.String(app.App),
-	})
+	certArn := *out.CertificateArn
 
-	var arn string
+	L.Info("requested ACM certificate, waiting for DNS validation record", "arn", certArn)
 
-	if err == nil {
-		var newLayers bool
+	deadline := time.Now().Add(certPollTimeout)
 
-		for _, layer := range fnInfo.Configuration.Layers {
-			if !(*layer.Arn == preLayer || *layer.Arn == libLayer) {
-				newLayers = true
-				break
-			}
+	for {
+		desc, err := svc.DescribeCertificate(&acm.DescribeCertificateInput{
+			CertificateArn: aws.String(certArn),
+		})
+		if err != nil {
+			return "", err
 		}
 
-		if newLayers {
-			L.Info("detected layer changes, updating function config")
-
-			_, err := lamSvc.UpdateFunctionConfiguration(&lambda.UpdateFunctionConfigurationInput{
-				FunctionName: aws.String(app.App),
-				Layers:       []*string{aws.String(preLayer), aws.String(libLayer)},
-				Handler:      aws.String("app.handler"),
-				Role:         aws.String(d.roleArn),
-				Timeout:      aws.Int64(DefaultTimeout),
-				MemorySize:   aws.Int64(DefaultMemory),
-				Runtime:      aws.String(info.Runtime),
-			})
+		cert := desc.Certificate
 
-			if err != nil {
-				return "", err
+		if len(cert.DomainValidationOptions) > 0 && cert.DomainValidationOptions[0].ResourceRecord != nil {
+			rr := cert.DomainValidationOptions[0].ResourceRecord
+
+			if err := d.upsertRoute53(zoneId, *rr.Name, *rr.Type, nil, []*route53.ResourceRecord{
+				{Value: rr.Value},
+			}); err != nil {
+				return "", errors.Wrap(err, "writing validation record")
 			}
 		}
 
-		funcCfg, err := lamSvc.UpdateFunctionCode(&lambda.UpdateFunctionCodeInput{
-			FunctionName: aws.String(app.App),
-			S3Bucket:     aws.String(d.config.Bucket),
-			S3Key:        aws.String(layerName),
-		})
+		if aws.StringValue(cert.Status) == acm.CertificateStatusIssued {
+			L.Info("certificate issued", "arn", certArn)
+			return certArn, nil
+		}
 
-		if err != nil {
-			return "", err
+		if time.Now().After(deadline) {
+			return "", fmt.Errorf("timed out waiting for certificate %s to validate (status %s)", certArn, aws.StringValue(cert.Status))
 		}
 
-		ver, err := lamSvc.PublishVersion(&lambda.PublishVersionInput{
-			CodeSha256:   funcCfg.CodeSha256,
-			FunctionName: aws.String(app.App),
-		})
+		time.Sleep(certPollInterval)
+	}
+}
 
-		if err != nil {
-			return "", err
+// findIssuedCertificate returns the ARN of an already-ISSUED certificate
+// for name that's tagged devflow.app=app.App, or "" if none exists.
+func (d *Deployer) findIssuedCertificate(svc *acm.ACM, app *component.Source, name string) (string, error) {
+	var found string
+
+	err := svc.ListCertificatesPages(&acm.ListCertificatesInput{
+		CertificateStatuses: []*string{aws.String(acm.CertificateStatusIssued)},
+	}, func(page *acm.ListCertificatesOutput, lastPage bool) bool {
+		for _, summary := range page.CertificateSummaryList {
+			if aws.StringValue(summary.DomainName) != name {
+				continue
+			}
+
+			tagsOut, err := svc.ListTagsForCertificate(&acm.ListTagsForCertificateInput{
+				CertificateArn: summary.CertificateArn,
+			})
+			if err != nil {
+				continue
+			}
+
+			for _, tag := range tagsOut.Tags {
+				if aws.StringValue(tag.Key) == "devflow.app" && aws.StringValue(tag.Value) == app.App {
+					found = aws.StringValue(summary.CertificateArn)
+					return false
+				}
+			}
 		}
 
-		arn = *ver.FunctionArn
+		return true
+	})
+	if err != nil {
+		return "", err
+	}
+
+	return found, nil
+}
 
-		L.Info("updated function", "arn", arn, "sha", *funcCfg.CodeSha256)
+// upsertRoute53 writes a single resource record set into zoneId, either an
+// alias (when alias is non-nil) or a plain record with the given values.
+func (d *Deployer) upsertRoute53(zoneId, name, recordType string, alias *route53.AliasTarget, values []*route53.ResourceRecord) error {
+	svc := route53.New(sess)
 
+	rrs := &route53.ResourceRecordSet{
+		Name: aws.String(name),
+		Type: aws.String(recordType),
+	}
+
+	if alias != nil {
+		rrs.AliasTarget = alias
 	} else {
-		funcOut, err := lamSvc.CreateFunction(&lambda.CreateFunctionInput{
-			Description:  aws.String(fmt.Sprintf("devflow app %s - %s", app.App, info.BuildId)),
-			FunctionName: aws.String(app.App),
-			Handler:      aws.String("app.handler"),
-			Role:         aws.String(d.roleArn),
-			Runtime:      aws.String(info.Runtime),
-			Layers:       []*string{aws.String(preLayer), aws.String(libLayer)},
-			Timeout:      aws.Int64(DefaultTimeout),
-			MemorySize:   aws.Int64(DefaultMemory),
-			Tags: map[string]*string{
-				"devflow.app":    aws.String(app.App),
-				"devflow.app.id": aws.String(info.BuildId),
-			},
-			Code: &lambda.FunctionCode{
-				S3Bucket: aws.String(d.config.Bucket),
-				S3Key:    aws.String(layerName),
+		rrs.TTL = aws.Int64(300)
+		rrs.ResourceRecords = values
+	}
+
+	_, err := svc.ChangeResourceRecordSets(&route53.ChangeResourceRecordSetsInput{
+		HostedZoneId: aws.String(zoneId),
+		ChangeBatch: &route53.ChangeBatch{
+			Changes: []*route53.Change{
+				{
+					Action:            aws.String("UPSERT"),
+					ResourceRecordSet: rrs,
+				},
 			},
-		})
+		},
+	})
 
-		if err != nil {
-			return "", err
-		}
+	return err
+}
 
-		ver, err := lamSvc.PublishVersion(&lambda.PublishVersionInput{
-			CodeSha256:   funcOut.CodeSha256,
-			FunctionName: aws.String(app.App),
-		})
+// findHostedZone walks the account's hosted zones and returns the id of
+// the one whose name is the longest suffix match for domain, so a
+// hosted zone doesn't need to be configured explicitly for every app.
+func (d *Deployer) findHostedZone(domain string) (string, error) {
+	svc := route53.New(sess)
 
-		if err != nil {
-			return "", err
-		}
+	var (
+		best    string
+		bestLen int
+	)
 
-		arn = *ver.FunctionArn
+	err := svc.ListHostedZonesPages(&route53.ListHostedZonesInput{}, func(page *route53.ListHostedZonesOutput, lastPage bool) bool {
+		for _, z := range page.HostedZones {
+			name := strings.TrimSuffix(*z.Name, ".")
+			if strings.HasSuffix(domain, name) && len(name) > bestLen {
+				best = *z.Id
+				bestLen = len(name)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return "", err
+	}
 
-		L.Info("created function", "arn", arn, "sha", *funcOut.CodeSha256)
+	if best == "" {
+		return "", fmt.Errorf("no hosted zone found for domain %q", domain)
 	}
 
-	return arn, nil
+	return best, nil
 }
 
 // MarshalText implements encoding.TextMarshaler so that protobuf generates
@@ -398,18 +543,127 @@ func (l *LambdaDeployment) MarshalText() ([]byte, error) {
 	return []byte(l.FunctionArn), nil
 }
 
+// Deploy uploads the app's code and layers to S3, converges the role and
+// function through this app's CloudFormation stack, then shifts alias
+// traffic to the new version and wires up the HTTP API and custom domain
+// (if configured) with a second converge of the same stack. Two
+// converges are needed because alias routing is managed with direct
+// Lambda API calls, not the template - see TrafficConfig - so the
+// alias's ARN, which the API integration targets, isn't known until
+// after the function itself has converged. Code and layers are uploaded
+// out-of-band because CloudFormation has no way to do that itself.
 func (d *Deployer) Deploy(ctx context.Context, L hclog.Logger, app *component.Source, info *AppInfo) (*LambdaDeployment, error) {
-	err := d.SetupRole(L, app)
+	if d.config.Domain != nil && d.config.HTTP == nil {
+		return nil, fmt.Errorf("domain is configured but http is not; domain requires http to also be set")
+	}
+
+	appKey, err := d.uploadAppZip(L, app, info)
+	if err != nil {
+		return nil, err
+	}
+
+	appSha256, err := LambdaCodeSha256(info.AppZip)
+	if err != nil {
+		return nil, err
+	}
+
+	preLayer, err := d.CreatePreLayer(L, app, info, info.PreZip)
 	if err != nil {
 		return nil, err
 	}
 
-	arn, err := d.CreateFunction(L, app, info)
+	libLayer, err := d.CreateLibraryLayer(L, app, info, info.LibZip)
 	if err != nil {
 		return nil, err
 	}
 
-	return &LambdaDeployment{FunctionArn: arn}, nil
+	layers := []string{preLayer, libLayer}
+
+	if d.config.HTTP != nil {
+		shimLayer, err := d.CreateShimLayer(L, app, info)
+		if err != nil {
+			return nil, err
+		}
+
+		layers = append(layers, shimLayer)
+	}
+
+	tmpl := stack.New()
+
+	roleId := tmpl.AddExecutionRole("ExecutionRole", roleName(app.App))
+
+	_, versionId := tmpl.AddFunction("Function", "Version", stack.FunctionSpec{
+		Name:       app.App,
+		S3Bucket:   d.config.Bucket,
+		S3Key:      appKey,
+		CodeSha256: appSha256,
+		Handler:    "app.handler",
+		Runtime:    info.Runtime,
+		RoleRef:    stack.GetAtt(roleId, "Arn"),
+		Layers:     layers,
+		Timeout:    DefaultTimeout,
+		MemorySize: DefaultMemory,
+		Tags: map[string]string{
+			"devflow.app":    app.App,
+			"devflow.app.id": info.BuildId,
+		},
+	}, roleId)
+
+	tmpl.Output("FunctionVersion", stack.GetAtt(versionId, "Version"))
+
+	outputs, err := stack.Converge(L, app.App, tmpl)
+	if err != nil {
+		return nil, err
+	}
+
+	newVersion := outputs["FunctionVersion"]
+
+	aliasArn, previousVersion, err := d.shiftTraffic(L, app, newVersion)
+	if err != nil {
+		return nil, err
+	}
+
+	dep := &LambdaDeployment{
+		FunctionArn:     aliasArn,
+		PendingVersion:  newVersion,
+		PreviousVersion: previousVersion,
+	}
+
+	if d.config.HTTP != nil {
+		apiId := d.addHTTPAPI(tmpl, app, aliasArn)
+		tmpl.Output("ApiId", stack.Ref(apiId))
+		tmpl.Output("InvokeUrl", stack.GetAtt(apiId, "ApiEndpoint"))
+
+		if d.config.Domain != nil {
+			if err := d.addDomain(L, tmpl, app, apiId); err != nil {
+				return nil, err
+			}
+		}
+
+		outputs, err = stack.Converge(L, app.App, tmpl)
+		if err != nil {
+			return nil, err
+		}
+
+		dep.HttpApiId = outputs["ApiId"]
+		dep.Url = outputs["InvokeUrl"]
+
+		if d.config.Domain != nil {
+			dep.Url = "https://" + d.config.Domain.Name
+		}
+	}
+
+	if err := d.bakeCanary(ctx, L, app, newVersion, previousVersion); err != nil {
+		return dep, err
+	}
+
+	return dep, nil
+}
+
+// Destroy tears down the CloudFormation stack backing app, removing
+// every resource this platform created for it in one step.
+func (d *Deployer) Destroy(ctx context.Context, L hclog.Logger, app *component.Source) error {
+	return stack.Destroy(L, app.App)
 }
 
 func (d *Deployer) Exec(ctx context.Context, L hclog.Logger, S status.Updater, app *component.Source) error {
@@ -542,77 +796,100 @@ func (d *Deployer) ConfigGetFunc() interface{} {
 	return d.ConfigGet
 }
 
+// logsEmptyBackoff is how long NextLogBatch sleeps between empty polls so
+// a `waypoint logs -f` tail doesn't hammer FilterLogEvents.
+const logsEmptyBackoff = 2 * time.Second
+
+// cloudwatchLogsViewer tails a log group with FilterLogEvents, driven by
+// a monotonically advancing time cursor, instead of walking each stream
+// once and returning nil at the end. That makes it suitable for both a
+// one-shot `waypoint logs` and an indefinite `waypoint logs -f`.
 type cloudwatchLogsViewer struct {
-	logs      *cloudwatchlogs.CloudWatchLogs
-	group     string
-	lastToken *string
+	logs   *cloudwatchlogs.CloudWatchLogs
+	group  string
+	filter string
 
-	stream  *cloudwatchlogs.LogStream
-	streams []*cloudwatchlogs.LogStream
+	lastEventTime int64
+	nextToken     *string
 }
 
 func (c *cloudwatchLogsViewer) NextLogBatch(ctx context.Context) ([]component.LogEvent, error) {
 	for {
-		if c.stream == nil {
-			if len(c.streams) == 0 {
-				return nil, nil
-			}
-			c.stream = c.streams[0]
-			c.streams = c.streams[1:]
-			c.lastToken = nil
+		input := &cloudwatchlogs.FilterLogEventsInput{
+			LogGroupName: aws.String(c.group),
+			StartTime:    aws.Int64(c.lastEventTime + 1),
+			EndTime:      aws.Int64(time.Now().UnixNano() / int64(time.Millisecond)),
+			NextToken:    c.nextToken,
 		}
 
-		output, err := c.logs.GetLogEvents(&cloudwatchlogs.GetLogEventsInput{
-			NextToken:     c.lastToken,
-			StartFromHead: aws.Bool(true),
-			LogGroupName:  aws.String(c.group),
-			LogStreamName: c.stream.LogStreamName,
-		})
+		if c.filter != "" {
+			input.FilterPattern = aws.String(c.filter)
+		}
 
+		output, err := c.logs.FilterLogEvents(input)
 		if err != nil {
 			return nil, err
 		}
 
-		if len(output.Events) != 0 {
-			c.lastToken = output.NextForwardToken
+		c.nextToken = output.NextToken
 
-			events := make([]component.LogEvent, len(output.Events))
+		if len(output.Events) == 0 {
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			default:
+			}
 
-			for i, ev := range output.Events {
-				ms := *ev.Timestamp
-				ts := time.Unix(ms/1000, (ms%1000)*1000000)
-				msg := strings.TrimRight(*ev.Message, "\n\t")
-				events[i] = component.LogEvent{
-					Partition: *c.stream.LogStreamName,
-					Timestamp: ts,
-					Message:   msg,
-				}
+			if c.nextToken != nil {
+				continue
 			}
 
-			return events, nil
+			select {
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			case <-time.After(logsEmptyBackoff):
+			}
+
+			continue
+		}
+
+		sort.Slice(output.Events, func(i, j int) bool {
+			return *output.Events[i].Timestamp < *output.Events[j].Timestamp
+		})
+
+		events := make([]component.LogEvent, len(output.Events))
+
+		for i, ev := range output.Events {
+			ms := *ev.Timestamp
+			if ms > c.lastEventTime {
+				c.lastEventTime = ms
+			}
+
+			ts := time.Unix(ms/1000, (ms%1000)*1000000)
+			msg := strings.TrimRight(*ev.Message, "\n\t")
+			events[i] = component.LogEvent{
+				Partition: *ev.LogStreamName,
+				Timestamp: ts,
+				Message:   msg,
+			}
 		}
 
-		c.stream = nil
+		return events, nil
 	}
 }
 
-func (d *Deployer) Logs(ctx context.Context, L hclog.Logger, app *component.Source) (component.LogViewer, error) {
+func (d *Deployer) Logs(ctx context.Context, L hclog.Logger, app *component.Source, opts *component.LogsOptions) (component.LogViewer, error) {
 	logs := cloudwatchlogs.New(sess)
 
-	streams, err := logs.DescribeLogStreams(&cloudwatchlogs.DescribeLogStreamsInput{
-		LogGroupName: aws.String(fmt.Sprintf("/aws/lambda/%s", app.App)),
-		Descending:   aws.Bool(false),
-		OrderBy:      aws.String("LastEventTime"),
-	})
-
-	if err != nil {
-		return nil, err
+	var filter string
+	if opts != nil {
+		filter = opts.Filter
 	}
 
 	return &cloudwatchLogsViewer{
-		logs:    logs,
-		group:   fmt.Sprintf("/aws/lambda/%s", app.App),
-		streams: streams.LogStreams,
+		logs:   logs,
+		group:  fmt.Sprintf("/aws/lambda/%s", app.App),
+		filter: filter,
 	}, nil
 }
 
@@ -0,0 +1,53 @@
+package lambda
+
+import (
+	"github.com/hashicorp/go-hclog"
+	"github.com/mitchellh/devflow/internal/pkg/retry"
+)
+
+// RetryRule is one entry of this platform's retry policy. See
+// retry.Rule for the matching and backoff semantics; it's aliased here
+// so hcl config and existing callers keep referring to it by its
+// package-local name.
+type RetryRule = retry.Rule
+
+// defaultRetryRules covers the transient failures the direct S3 and
+// Lambda API calls this package still makes (layer/app uploads, alias
+// updates) tend to hit: a prior update still in flight, and ordinary
+// throttling.
+//
+// IAM's eventual consistency before a just-created role can be assumed
+// no longer needs a rule here: CreateFunction/SetupRole made that call
+// directly before the stack package existed, but CloudFormation now
+// creates the function as part of stack.Converge, which has to detect
+// and retry that failure itself - see
+// stack.rolePropagationFailureReason.
+var defaultRetryRules = []RetryRule{
+	{
+		ErrorEquals:     []string{"ResourceConflictException"},
+		IntervalSeconds: 2,
+		MaxAttempts:     6,
+		BackoffRate:     2,
+	},
+	{
+		ErrorEquals:     []string{"Throttling", "TooManyRequestsException", "ThrottlingException"},
+		IntervalSeconds: 1,
+		MaxAttempts:     6,
+		BackoffRate:     2,
+	},
+}
+
+// retries returns the effective retry policy: the app's override if one
+// was configured, otherwise defaultRetryRules.
+func (d *Deployer) retries() []RetryRule {
+	if len(d.config.Retries) > 0 {
+		return d.config.Retries
+	}
+	return defaultRetryRules
+}
+
+// withRetry calls fn under rules, retrying transient awserr.Error
+// failures per retry.Do.
+func withRetry(L hclog.Logger, rules []RetryRule, fn func() error) error {
+	return retry.Do(L, rules, fn)
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-lambda-go/events"
+)
+
+// appStartTimeout bounds how long we wait for the wrapped app to start
+// accepting connections on its port (PORT, default 8080) before we give up.
+const appStartTimeout = 10 * time.Second
+
+// Handler execs the app binary once per Lambda container and proxies
+// every invocation to it over HTTP on localhost, converting between API
+// Gateway's proxy event shape and a normal HTTP request/response.
+type Handler struct {
+	cmd    *exec.Cmd
+	client *http.Client
+	addr   string
+}
+
+// NewHandler starts the app binary (named by the DEVFLOW_APP_BIN env var,
+// defaulting to ./app) and waits for it to accept connections before
+// returning.
+func NewHandler() (*Handler, error) {
+	bin := os.Getenv("DEVFLOW_APP_BIN")
+	if bin == "" {
+		bin = "./app"
+	}
+
+	port := os.Getenv("PORT")
+	if port == "" {
+		port = "8080"
+	}
+
+	cmd := exec.Command(bin)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(), "PORT="+port)
+
+	if err := cmd.Start(); err != nil {
+		return nil, fmt.Errorf("starting app binary %q: %w", bin, err)
+	}
+
+	addr := "127.0.0.1:" + port
+
+	deadline := time.Now().Add(appStartTimeout)
+	for {
+		conn, err := net.DialTimeout("tcp", addr, time.Second)
+		if err == nil {
+			conn.Close()
+			break
+		}
+
+		if time.Now().After(deadline) {
+			return nil, fmt.Errorf("app never came up on %s: %w", addr, err)
+		}
+
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	return &Handler{
+		cmd:    cmd,
+		client: &http.Client{Timeout: 0},
+		addr:   addr,
+	}, nil
+}
+
+// Close tears down the wrapped app process. It's best-effort: Lambda
+// freezes or reclaims the container regardless of what we do here.
+func (h *Handler) Close() {
+	if h.cmd != nil && h.cmd.Process != nil {
+		h.cmd.Process.Kill()
+	}
+}
+
+// Invoke is the lambda.Start handler func. It decodes the v2 HTTP API
+// payload format, which is what the stack's integration is configured to
+// send; the classic REST API (v1) proxy format is not handled.
+func (h *Handler) Invoke(ctx context.Context, raw events.APIGatewayV2HTTPRequest) (events.APIGatewayV2HTTPResponse, error) {
+	method := raw.RequestContext.HTTP.Method
+	path := raw.RawPath
+	if raw.RawQueryString != "" {
+		path += "?" + raw.RawQueryString
+	}
+
+	var body io.Reader
+	if raw.Body != "" {
+		if raw.IsBase64Encoded {
+			decoded, err := base64.StdEncoding.DecodeString(raw.Body)
+			if err != nil {
+				return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("decoding request body: %w", err)
+			}
+			body = bytes.NewReader(decoded)
+		} else {
+			body = strings.NewReader(raw.Body)
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, "http://"+h.addr+path, body)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("building shim request: %w", err)
+	}
+
+	for k, v := range raw.Headers {
+		req.Header.Set(k, v)
+	}
+
+	resp, err := h.client.Do(req)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("calling app: %w", err)
+	}
+	defer resp.Body.Close()
+
+	respBody, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return events.APIGatewayV2HTTPResponse{}, fmt.Errorf("reading app response: %w", err)
+	}
+
+	headers := make(map[string]string, len(resp.Header))
+	for k := range resp.Header {
+		headers[k] = resp.Header.Get(k)
+	}
+
+	return events.APIGatewayV2HTTPResponse{
+		StatusCode:      resp.StatusCode,
+		Headers:         headers,
+		Body:            base64.StdEncoding.EncodeToString(respBody),
+		IsBase64Encoded: true,
+	}, nil
+}
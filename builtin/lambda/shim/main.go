@@ -0,0 +1,21 @@
+// Command shim is the Lambda entrypoint bundled alongside an app's own
+// binary. It translates API Gateway HTTP API ($default stage) proxy events
+// into a plain HTTP request against the app (started as a child process that
+// speaks HTTP on a local port), and translates the app's HTTP response back
+// into a proxy response. This lets any framework that just speaks HTTP run
+// behind Lambda unmodified, the same trick used by apex/up.
+package main
+
+import (
+	"github.com/aws/aws-lambda-go/lambda"
+)
+
+func main() {
+	h, err := NewHandler()
+	if err != nil {
+		panic(err)
+	}
+	defer h.Close()
+
+	lambda.Start(h.Invoke)
+}
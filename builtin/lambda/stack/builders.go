@@ -0,0 +1,171 @@
+package stack
+
+// AddExecutionRole adds the IAM role Lambda assumes to run the function,
+// with the basic execution managed policy attached. Returns the logical
+// id so callers can Ref/GetAtt it from other resources.
+func (t *Template) AddExecutionRole(logicalId, roleName string) string {
+	return t.Add(logicalId, "AWS::IAM::Role", map[string]interface{}{
+		"RoleName": roleName,
+		"AssumeRolePolicyDocument": map[string]interface{}{
+			"Version": "2012-10-17",
+			"Statement": []map[string]interface{}{
+				{
+					"Effect":    "Allow",
+					"Principal": map[string]interface{}{"Service": "lambda.amazonaws.com"},
+					"Action":    "sts:AssumeRole",
+				},
+			},
+		},
+		"ManagedPolicyArns": []string{
+			"arn:aws:iam::aws:policy/service-role/AWSLambdaBasicExecutionRole",
+		},
+	})
+}
+
+// FunctionSpec describes the properties of the AWS::Lambda::Function
+// resource, already resolved (S3 code location, layer ARNs, role) by the
+// caller.
+type FunctionSpec struct {
+	Name       string
+	S3Bucket   string
+	S3Key      string
+	CodeSha256 string
+	Handler    string
+	Runtime    string
+	RoleRef    map[string]interface{}
+	Layers     []string
+	Timeout    int64
+	MemorySize int64
+	Tags       map[string]string
+}
+
+// AddFunction adds the function resource plus a version resource
+// snapshotting the code that was just uploaded, so the version survives
+// future updates to the function resource itself. CodeSha256 is set on
+// the version so CloudFormation sees a diff and actually publishes a
+// new version when the code changes; without it, the Version resource
+// has nothing but a Ref to the function on it, never changes, and every
+// deploy after the first would stay pinned to the first version ever
+// published.
+func (t *Template) AddFunction(logicalId, versionLogicalId string, spec FunctionSpec, dependsOn ...string) (fn, version string) {
+	tags := make([]map[string]interface{}, 0, len(spec.Tags))
+	for k, v := range spec.Tags {
+		tags = append(tags, map[string]interface{}{"Key": k, "Value": v})
+	}
+
+	fn = t.Add(logicalId, "AWS::Lambda::Function", map[string]interface{}{
+		"FunctionName": spec.Name,
+		"Handler":      spec.Handler,
+		"Runtime":      spec.Runtime,
+		"Role":         spec.RoleRef,
+		"Layers":       spec.Layers,
+		"Timeout":      spec.Timeout,
+		"MemorySize":   spec.MemorySize,
+		"Tags":         tags,
+		"Code": map[string]interface{}{
+			"S3Bucket": spec.S3Bucket,
+			"S3Key":    spec.S3Key,
+		},
+	}, dependsOn...)
+
+	version = t.Add(versionLogicalId, "AWS::Lambda::Version", map[string]interface{}{
+		"FunctionName": Ref(logicalId),
+		"CodeSha256":   spec.CodeSha256,
+	})
+
+	return fn, version
+}
+
+// AddInvokePermission grants principal permission to invoke
+// functionName (an alias ARN, or a Ref/GetAtt to a resource in this
+// template), scoped with sourceArn when given (a literal ARN, or an
+// intrinsic like Fn::Sub). Always pass a sourceArn for principals like
+// apigateway.amazonaws.com: omitting it lets any API in the account
+// invoke the function, not just the one this permission is meant for.
+func (t *Template) AddInvokePermission(logicalId string, functionName interface{}, principal string, sourceArn interface{}) string {
+	props := map[string]interface{}{
+		"Action":       "lambda:InvokeFunction",
+		"FunctionName": functionName,
+		"Principal":    principal,
+	}
+
+	if sourceArn != nil {
+		props["SourceArn"] = sourceArn
+	}
+
+	return t.Add(logicalId, "AWS::Lambda::Permission", props)
+}
+
+// AddHttpApi adds an HTTP API with a single AWS_PROXY route targeting
+// integrationTarget (an alias ARN, or a Ref/GetAtt to a resource in this
+// template), along with its default auto-deployed stage. timeoutMillis
+// sets the integration's timeout when greater than zero, otherwise API
+// Gateway's own default applies.
+func (t *Template) AddHttpApi(apiLogicalId, integLogicalId, routeLogicalId, stageLogicalId string, name, routeKey, stageName string, integrationTarget interface{}, timeoutMillis int64) string {
+	api := t.Add(apiLogicalId, "AWS::ApiGatewayV2::Api", map[string]interface{}{
+		"Name":         name,
+		"ProtocolType": "HTTP",
+	})
+
+	integProps := map[string]interface{}{
+		"ApiId":                Ref(apiLogicalId),
+		"IntegrationType":      "AWS_PROXY",
+		"IntegrationUri":       integrationTarget,
+		"PayloadFormatVersion": "2.0",
+	}
+
+	if timeoutMillis > 0 {
+		integProps["TimeoutInMillis"] = timeoutMillis
+	}
+
+	t.Add(integLogicalId, "AWS::ApiGatewayV2::Integration", integProps, apiLogicalId)
+
+	t.Add(routeLogicalId, "AWS::ApiGatewayV2::Route", map[string]interface{}{
+		"ApiId":    Ref(apiLogicalId),
+		"RouteKey": routeKey,
+		"Target": map[string]interface{}{
+			"Fn::Sub": "integrations/${" + integLogicalId + "}",
+		},
+	}, integLogicalId)
+
+	t.Add(stageLogicalId, "AWS::ApiGatewayV2::Stage", map[string]interface{}{
+		"ApiId":      Ref(apiLogicalId),
+		"StageName":  stageName,
+		"AutoDeploy": true,
+	}, apiLogicalId)
+
+	return api
+}
+
+// AddDomain adds a custom domain name bound to certArn, mapped to
+// apiLogicalId's stage, and a Route53 alias record pointing at it.
+func (t *Template) AddDomain(domainLogicalId, mappingLogicalId, recordLogicalId string, domainName, certArn, apiLogicalId, stageName, hostedZoneId string) string {
+	domain := t.Add(domainLogicalId, "AWS::ApiGatewayV2::DomainName", map[string]interface{}{
+		"DomainName": domainName,
+		"DomainNameConfigurations": []map[string]interface{}{
+			{
+				"CertificateArn": certArn,
+				"EndpointType":   "REGIONAL",
+			},
+		},
+	})
+
+	t.Add(mappingLogicalId, "AWS::ApiGatewayV2::ApiMapping", map[string]interface{}{
+		"DomainName": Ref(domainLogicalId),
+		"ApiId":      Ref(apiLogicalId),
+		"Stage":      stageName,
+	}, domainLogicalId, apiLogicalId)
+
+	t.Add(recordLogicalId, "AWS::Route53::RecordSet", map[string]interface{}{
+		"HostedZoneId": hostedZoneId,
+		"Name":         domainName,
+		"Type":         "A",
+		"AliasTarget": map[string]interface{}{
+			"DNSName":              GetAtt(domainLogicalId, "RegionalDomainName"),
+			"HostedZoneId":         GetAtt(domainLogicalId, "RegionalHostedZoneId"),
+			"EvaluateTargetHealth": false,
+		},
+	}, domainLogicalId)
+
+	return domain
+}
@@ -0,0 +1,251 @@
+package stack
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/hashicorp/go-hclog"
+	"github.com/mitchellh/devflow/internal/pkg/retry"
+)
+
+// stackName is the one stack-per-app naming convention: every resource
+// for an app lives in a single stack named after it.
+func stackName(app string) string {
+	return "devflow-" + app
+}
+
+// defaultRetryRules covers the transient failures a rapid sequence of
+// converges (concurrent deploys, or a deploy retried right after a
+// previous one) tends to hit: a change set or stack mutation still in
+// flight, and ordinary API throttling.
+var defaultRetryRules = []retry.Rule{
+	{
+		ErrorEquals:     []string{"OperationInProgressException"},
+		IntervalSeconds: 5,
+		MaxAttempts:     10,
+		BackoffRate:     1.5,
+	},
+	{
+		ErrorEquals:     []string{"Throttling", "ThrottlingException", "TooManyRequestsException"},
+		IntervalSeconds: 2,
+		MaxAttempts:     6,
+		BackoffRate:     2,
+	},
+}
+
+// rolePropagationFailureReason is the CloudFormation resource status
+// reason seen when a Function resource fails to create because the IAM
+// role it depends on hasn't finished propagating yet. CloudFormation
+// only surfaces this in the stack's events, not as an awserr from the
+// API calls convergeOnce makes directly, so defaultRetryRules can't
+// catch it - it needs Converge's own retry loop.
+const rolePropagationFailureReason = "cannot be assumed by Lambda"
+
+// rolePropagationMaxAttempts bounds how many times, in total, Converge
+// attempts a stack operation that keeps failing purely because of IAM
+// role propagation.
+const rolePropagationMaxAttempts = 5
+
+// Converge creates or updates the stack for app to match tmpl, via a
+// change set, and returns the stack's outputs once it settles. An empty
+// change set (no drift) is treated as success, not an error. A failure
+// caused by a just-created IAM role not having propagated yet is
+// retried from scratch - CloudFormation rolls the failed resource back,
+// so there's nothing to resume, only a fresh change set to try again.
+func Converge(L hclog.Logger, app string, tmpl *Template) (map[string]string, error) {
+	svc := cloudformation.New(session.New())
+	name := stackName(app)
+
+	for attempt := 1; ; attempt++ {
+		outputs, err := convergeOnce(L, svc, app, name, tmpl)
+		if err == nil {
+			return outputs, nil
+		}
+
+		if attempt >= rolePropagationMaxAttempts || !stackFailedOnRolePropagation(svc, name) {
+			return nil, err
+		}
+
+		sleep := time.Duration(attempt) * 5 * time.Second
+		L.Warn("stack failed while IAM role was still propagating, retrying", "stack", name, "attempt", attempt, "sleep", sleep)
+		time.Sleep(sleep)
+	}
+}
+
+func convergeOnce(L hclog.Logger, svc *cloudformation.CloudFormation, app, name string, tmpl *Template) (map[string]string, error) {
+	body, err := tmpl.JSON()
+	if err != nil {
+		return nil, err
+	}
+
+	changeSetType := "UPDATE"
+	if !stackExists(svc, name) {
+		changeSetType = "CREATE"
+	}
+
+	changeSetName := fmt.Sprintf("%s-%d", name, changeSetSeq())
+
+	L.Info("creating change set", "stack", name, "type", changeSetType)
+
+	err = retry.Do(L, defaultRetryRules, func() error {
+		_, err := svc.CreateChangeSet(&cloudformation.CreateChangeSetInput{
+			StackName:     aws.String(name),
+			ChangeSetName: aws.String(changeSetName),
+			ChangeSetType: aws.String(changeSetType),
+			TemplateBody:  aws.String(string(body)),
+			Capabilities:  []*string{aws.String("CAPABILITY_NAMED_IAM")},
+			Tags: []*cloudformation.Tag{
+				{Key: aws.String("devflow.app"), Value: aws.String(app)},
+			},
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating change set: %w", err)
+	}
+
+	err = retry.Do(L, defaultRetryRules, func() error {
+		return svc.WaitUntilChangeSetCreateComplete(&cloudformation.DescribeChangeSetInput{
+			StackName:     aws.String(name),
+			ChangeSetName: aws.String(changeSetName),
+		})
+	})
+	if err != nil {
+		desc, descErr := svc.DescribeChangeSet(&cloudformation.DescribeChangeSetInput{
+			StackName:     aws.String(name),
+			ChangeSetName: aws.String(changeSetName),
+		})
+		if descErr == nil && noChangesToExecute(desc) {
+			L.Info("no infrastructure changes to apply", "stack", name)
+			return describeOutputs(svc, name)
+		}
+
+		return nil, fmt.Errorf("waiting for change set: %w", err)
+	}
+
+	L.Info("executing change set", "stack", name)
+
+	err = retry.Do(L, defaultRetryRules, func() error {
+		_, err := svc.ExecuteChangeSet(&cloudformation.ExecuteChangeSetInput{
+			StackName:     aws.String(name),
+			ChangeSetName: aws.String(changeSetName),
+		})
+		return err
+	})
+	if err != nil {
+		return nil, fmt.Errorf("executing change set: %w", err)
+	}
+
+	err = retry.Do(L, defaultRetryRules, func() error {
+		if changeSetType == "CREATE" {
+			return svc.WaitUntilStackCreateComplete(&cloudformation.DescribeStacksInput{StackName: aws.String(name)})
+		}
+		return svc.WaitUntilStackUpdateComplete(&cloudformation.DescribeStacksInput{StackName: aws.String(name)})
+	})
+	if err != nil {
+		return nil, fmt.Errorf("waiting for stack to converge: %w", err)
+	}
+
+	return describeOutputs(svc, name)
+}
+
+// Destroy deletes the stack backing app, for component.Platform's
+// Destroy implementation.
+func Destroy(L hclog.Logger, app string) error {
+	svc := cloudformation.New(session.New())
+	name := stackName(app)
+
+	if !stackExists(svc, name) {
+		return nil
+	}
+
+	L.Info("deleting stack", "stack", name)
+
+	err := retry.Do(L, defaultRetryRules, func() error {
+		_, err := svc.DeleteStack(&cloudformation.DeleteStackInput{
+			StackName: aws.String(name),
+		})
+		return err
+	})
+	if err != nil {
+		return err
+	}
+
+	return svc.WaitUntilStackDeleteComplete(&cloudformation.DescribeStacksInput{StackName: aws.String(name)})
+}
+
+func stackExists(svc *cloudformation.CloudFormation, name string) bool {
+	out, err := svc.DescribeStacks(&cloudformation.DescribeStacksInput{StackName: aws.String(name)})
+	return err == nil && len(out.Stacks) > 0
+}
+
+// stackFailedOnRolePropagation reports whether name's most recent
+// events show a resource failing specifically because its IAM role
+// hadn't propagated yet, as opposed to any other provisioning failure.
+func stackFailedOnRolePropagation(svc *cloudformation.CloudFormation, name string) bool {
+	var found bool
+
+	_ = svc.DescribeStackEventsPages(&cloudformation.DescribeStackEventsInput{
+		StackName: aws.String(name),
+	}, func(page *cloudformation.DescribeStackEventsOutput, lastPage bool) bool {
+		for _, ev := range page.StackEvents {
+			if strings.Contains(aws.StringValue(ev.ResourceStatusReason), rolePropagationFailureReason) {
+				found = true
+				return false
+			}
+
+			// Events come newest first; stop at the stack-level event
+			// that started the most recent create or update.
+			if aws.StringValue(ev.ResourceType) == "AWS::CloudFormation::Stack" {
+				switch aws.StringValue(ev.ResourceStatus) {
+				case "CREATE_IN_PROGRESS", "UPDATE_IN_PROGRESS":
+					return false
+				}
+			}
+		}
+
+		return true
+	})
+
+	return found
+}
+
+// noChangesToExecute reports whether a change set failed to create
+// because it genuinely contained no changes to the stack, as opposed to
+// a real provisioning failure (bad template, missing capability,
+// resource conflict) that also leaves it in a FAILED state with zero
+// Changes. CloudFormation only distinguishes the two in StatusReason's
+// text, so match that rather than treating every empty, failed change
+// set as a no-op.
+func noChangesToExecute(desc *cloudformation.DescribeChangeSetOutput) bool {
+	return aws.StringValue(desc.Status) == "FAILED" &&
+		len(desc.Changes) == 0 &&
+		strings.Contains(aws.StringValue(desc.StatusReason), "didn't contain changes")
+}
+
+func describeOutputs(svc *cloudformation.CloudFormation, name string) (map[string]string, error) {
+	out, err := svc.DescribeStacks(&cloudformation.DescribeStacksInput{StackName: aws.String(name)})
+	if err != nil {
+		return nil, err
+	}
+
+	outputs := map[string]string{}
+	for _, o := range out.Stacks[0].Outputs {
+		outputs[aws.StringValue(o.OutputKey)] = aws.StringValue(o.OutputValue)
+	}
+
+	return outputs, nil
+}
+
+// seq is a process-local monotonic counter used to keep change set names
+// unique within a single deploy run.
+var seq int
+
+func changeSetSeq() int {
+	seq++
+	return seq
+}
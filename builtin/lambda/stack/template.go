@@ -0,0 +1,89 @@
+// Package stack renders and converges the single CloudFormation stack
+// that backs one Waypoint app's Lambda deployment: the IAM role, the
+// function and its versions, the HTTP API and its domain, and the DNS
+// record that points at it. Aliases are not in the stack; they are
+// updated with direct Lambda API calls. Centralizing all of that in one template
+// gives atomic rollback on failure and a single source of truth for
+// what a "deployment" is, instead of the ad hoc imperative SDK calls
+// the deployer used to make directly.
+//
+// Code that lives here only ever builds or converges templates; it never
+// uploads app code. Layer and app zips still go to S3 out-of-band because
+// CloudFormation has no way to upload code itself, but their bucket/key
+// are referenced from the template by the caller.
+package stack
+
+import "encoding/json"
+
+// resource is the generic shape of every entry in the template's
+// Resources map.
+type resource struct {
+	Type       string                 `json:"Type"`
+	Properties map[string]interface{} `json:"Properties,omitempty"`
+	DependsOn  []string               `json:"DependsOn,omitempty"`
+}
+
+// Template is a minimal CloudFormation template builder. It only knows
+// enough JSON shape to hold the resources Waypoint's Lambda platform
+// needs; it isn't a general-purpose CFN library.
+type Template struct {
+	resources map[string]resource
+	outputs   map[string]map[string]interface{}
+	order     []string
+}
+
+// New returns an empty Template ready to have resources added to it.
+func New() *Template {
+	return &Template{
+		resources: map[string]resource{},
+		outputs:   map[string]map[string]interface{}{},
+	}
+}
+
+// Add inserts a resource under logicalId, optionally depending on other
+// logical ids so CloudFormation orders creation correctly. Returns
+// logicalId so calls can be chained inline where that reads better.
+func (t *Template) Add(logicalId, resourceType string, properties map[string]interface{}, dependsOn ...string) string {
+	if _, exists := t.resources[logicalId]; !exists {
+		t.order = append(t.order, logicalId)
+	}
+
+	t.resources[logicalId] = resource{
+		Type:       resourceType,
+		Properties: properties,
+		DependsOn:  dependsOn,
+	}
+
+	return logicalId
+}
+
+// Output records a value to export from the stack, such as the
+// published function ARN or the API's invoke URL. Callers read these
+// back after a successful converge.
+func (t *Template) Output(name string, value interface{}) {
+	t.outputs[name] = map[string]interface{}{"Value": value}
+}
+
+// Ref returns the CloudFormation intrinsic `{"Ref": logicalId}`.
+func Ref(logicalId string) map[string]interface{} {
+	return map[string]interface{}{"Ref": logicalId}
+}
+
+// GetAtt returns the CloudFormation intrinsic `{"Fn::GetAtt": [...]}`.
+func GetAtt(logicalId, attribute string) map[string]interface{} {
+	return map[string]interface{}{"Fn::GetAtt": []string{logicalId, attribute}}
+}
+
+// JSON renders the template to CloudFormation's JSON template format.
+func (t *Template) JSON() ([]byte, error) {
+	doc := map[string]interface{}{
+		"AWSTemplateFormatVersion": "2010-09-09",
+		"Resources":                t.resources,
+	}
+
+	if len(t.outputs) > 0 {
+		doc["Outputs"] = t.outputs
+	}
+
+	return json.Marshal(doc)
+}
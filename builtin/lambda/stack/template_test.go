@@ -0,0 +1,91 @@
+package stack
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestTemplateJSON(t *testing.T) {
+	tmpl := New()
+
+	roleId := tmpl.AddExecutionRole("ExecutionRole", "lambda-app")
+	tmpl.Add("Function", "AWS::Lambda::Function", map[string]interface{}{
+		"FunctionName": "app",
+		"Role":         GetAtt(roleId, "Arn"),
+	}, roleId)
+	tmpl.Output("FunctionArn", GetAtt("Function", "Arn"))
+
+	body, err := tmpl.JSON()
+	if err != nil {
+		t.Fatalf("JSON: %v", err)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("unmarshaling rendered template: %v", err)
+	}
+
+	if doc["AWSTemplateFormatVersion"] != "2010-09-09" {
+		t.Errorf("AWSTemplateFormatVersion = %v, want 2010-09-09", doc["AWSTemplateFormatVersion"])
+	}
+
+	resources, ok := doc["Resources"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Resources = %v (%T), want map", doc["Resources"], doc["Resources"])
+	}
+
+	if _, ok := resources["ExecutionRole"]; !ok {
+		t.Errorf("Resources missing ExecutionRole")
+	}
+
+	fn, ok := resources["Function"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Resources[Function] = %v (%T), want map", resources["Function"], resources["Function"])
+	}
+
+	if fn["Type"] != "AWS::Lambda::Function" {
+		t.Errorf("Function Type = %v, want AWS::Lambda::Function", fn["Type"])
+	}
+
+	dependsOn, ok := fn["DependsOn"].([]interface{})
+	if !ok || len(dependsOn) != 1 || dependsOn[0] != "ExecutionRole" {
+		t.Errorf("Function DependsOn = %v, want [ExecutionRole]", fn["DependsOn"])
+	}
+
+	outputs, ok := doc["Outputs"].(map[string]interface{})
+	if !ok {
+		t.Fatalf("Outputs = %v (%T), want map", doc["Outputs"], doc["Outputs"])
+	}
+
+	if _, ok := outputs["FunctionArn"]; !ok {
+		t.Errorf("Outputs missing FunctionArn")
+	}
+}
+
+func TestTemplateJSONOmitsEmptyOutputs(t *testing.T) {
+	body, err := New().JSON()
+	if err != nil {
+		t.Fatalf("JSON: %v", err)
+	}
+
+	var doc map[string]interface{}
+	if err := json.Unmarshal(body, &doc); err != nil {
+		t.Fatalf("unmarshaling rendered template: %v", err)
+	}
+
+	if _, ok := doc["Outputs"]; ok {
+		t.Errorf("Outputs present with no outputs added: %v", doc["Outputs"])
+	}
+}
+
+func TestRefAndGetAtt(t *testing.T) {
+	if got := Ref("Thing"); got["Ref"] != "Thing" {
+		t.Errorf("Ref(Thing) = %v", got)
+	}
+
+	got := GetAtt("Thing", "Arn")
+	attr, ok := got["Fn::GetAtt"].([]string)
+	if !ok || len(attr) != 2 || attr[0] != "Thing" || attr[1] != "Arn" {
+		t.Errorf("GetAtt(Thing, Arn) = %v", got)
+	}
+}
@@ -0,0 +1,311 @@
+package lambda
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudwatch"
+	"github.com/aws/aws-sdk-go/service/lambda"
+	"github.com/hashicorp/go-hclog"
+	"github.com/mitchellh/devflow/sdk/component"
+	"github.com/pkg/errors"
+)
+
+// TrafficConfig controls canary/weighted traffic shifting between the
+// previously live function version and the one just deployed. Alias
+// routing is managed with direct Lambda API calls rather than through
+// the stack template: CloudFormation has no way to key a map entry
+// (RoutingConfig.AdditionalVersionWeights) off a value, like a version
+// number, that's only known once the function resource has converged.
+type TrafficConfig struct {
+	// Alias is the Lambda alias callers invoke. Defaults to "live".
+	Alias string `hcl:"alias,optional"`
+
+	// CanaryPercent is the percentage of invocations routed to the new
+	// version immediately after deploy; the remainder stays on the
+	// prior version until Promote is called. Zero means deploy goes
+	// straight to 100%.
+	CanaryPercent float64 `hcl:"canary_percent,optional"`
+
+	// BakeTime, when greater than zero, is how long Deploy watches the
+	// new version's Errors/Throttles metrics before returning. Zero
+	// returns immediately and leaves promotion to an external caller.
+	BakeTime time.Duration `hcl:"bake_time,optional"`
+
+	// ErrorThreshold aborts the canary, resetting the alias back to the
+	// prior version, if this many combined Errors+Throttles are seen
+	// for the new version during BakeTime. Zero disables the check.
+	ErrorThreshold float64 `hcl:"error_threshold,optional"`
+
+	// PreTrafficHook and PostTrafficHook are Lambda function ARNs
+	// invoked before traffic is shifted and after the bake completes.
+	PreTrafficHook  string `hcl:"pre_traffic_hook,optional"`
+	PostTrafficHook string `hcl:"post_traffic_hook,optional"`
+}
+
+func (c *TrafficConfig) alias() string {
+	if c.Alias == "" {
+		return "live"
+	}
+	return c.Alias
+}
+
+// shiftTraffic points app's alias at newVersion, weighting traffic
+// between it and whatever version the alias currently serves according
+// to d.config.Traffic. It returns the alias's ARN (stable across
+// deploys, suitable for downstream integrations) and the version that
+// was live before this call, for Rollback.
+func (d *Deployer) shiftTraffic(L hclog.Logger, app *component.Source, newVersion string) (aliasArn, previousVersion string, err error) {
+	if hook := d.trafficConfig().PreTrafficHook; hook != "" {
+		L.Info("invoking pre-traffic hook", "hook", hook, "version", newVersion)
+
+		if err := invokeHook(L, hook, map[string]string{"app": app.App, "version": newVersion}); err != nil {
+			return "", "", errors.Wrap(err, "pre-traffic hook")
+		}
+	}
+
+	lamSvc := lambda.New(sess)
+	aliasName := d.trafficConfig().alias()
+
+	existing, err := lamSvc.GetAlias(&lambda.GetAliasInput{
+		FunctionName: aws.String(app.App),
+		Name:         aws.String(aliasName),
+	})
+
+	if err != nil {
+		L.Info("creating alias", "alias", aliasName, "version", newVersion)
+
+		var out *lambda.AliasConfiguration
+
+		err := withRetry(L, d.retries(), func() error {
+			var err error
+			out, err = lamSvc.CreateAlias(&lambda.CreateAliasInput{
+				FunctionName:    aws.String(app.App),
+				Name:            aws.String(aliasName),
+				FunctionVersion: aws.String(newVersion),
+			})
+			return err
+		})
+		if err != nil {
+			return "", "", err
+		}
+
+		return *out.AliasArn, "", nil
+	}
+
+	previousVersion = *existing.FunctionVersion
+
+	pct := d.config.Traffic != nil && d.config.Traffic.CanaryPercent > 0
+
+	input := &lambda.UpdateAliasInput{
+		FunctionName: aws.String(app.App),
+		Name:         aws.String(aliasName),
+	}
+
+	if pct {
+		L.Info("shifting canary traffic", "alias", aliasName, "stable", previousVersion, "canary", newVersion, "percent", d.config.Traffic.CanaryPercent)
+
+		input.FunctionVersion = aws.String(previousVersion)
+		input.RoutingConfig = &lambda.AliasRoutingConfiguration{
+			AdditionalVersionWeights: map[string]*float64{
+				newVersion: aws.Float64(d.config.Traffic.CanaryPercent / 100),
+			},
+		}
+	} else {
+		L.Info("pointing alias at new version", "alias", aliasName, "version", newVersion)
+
+		input.FunctionVersion = aws.String(newVersion)
+		input.RoutingConfig = &lambda.AliasRoutingConfiguration{}
+	}
+
+	var out *lambda.AliasConfiguration
+
+	err = withRetry(L, d.retries(), func() error {
+		var err error
+		out, err = lamSvc.UpdateAlias(input)
+		return err
+	})
+	if err != nil {
+		return "", "", err
+	}
+
+	return *out.AliasArn, previousVersion, nil
+}
+
+// bakeCanary polls CloudWatch for the new version's Errors and
+// Throttles while d.config.Traffic.BakeTime elapses. If the combined
+// count ever crosses ErrorThreshold, it resets the alias back to
+// previousVersion and returns an error; otherwise it returns nil once
+// the bake window has passed.
+func (d *Deployer) bakeCanary(ctx context.Context, L hclog.Logger, app *component.Source, newVersion, previousVersion string) error {
+	cfg := d.config.Traffic
+	if cfg == nil || cfg.BakeTime <= 0 {
+		return nil
+	}
+
+	cwSvc := cloudwatch.New(sess)
+	deadline := time.Now().Add(cfg.BakeTime)
+
+	L.Info("baking canary", "version", newVersion, "duration", cfg.BakeTime)
+
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(30 * time.Second):
+		}
+
+		if cfg.ErrorThreshold <= 0 {
+			continue
+		}
+
+		total, err := sumMetrics(cwSvc, app.App, newVersion, time.Now())
+		if err != nil {
+			return err
+		}
+
+		if total >= cfg.ErrorThreshold {
+			L.Warn("canary error threshold crossed, rolling back alias", "version", newVersion, "count", total)
+
+			lamSvc := lambda.New(sess)
+			_, resetErr := lamSvc.UpdateAlias(&lambda.UpdateAliasInput{
+				FunctionName:    aws.String(app.App),
+				Name:            aws.String(cfg.alias()),
+				FunctionVersion: aws.String(previousVersion),
+				RoutingConfig:   &lambda.AliasRoutingConfiguration{},
+			})
+			if resetErr != nil {
+				return fmt.Errorf("canary aborted but resetting alias failed: %w (original: errors/throttles hit %v)", resetErr, total)
+			}
+
+			return fmt.Errorf("canary aborted: version %s hit %v errors/throttles, alias reset to %s", newVersion, total, previousVersion)
+		}
+	}
+
+	L.Info("canary baked successfully", "version", newVersion)
+
+	if hook := cfg.PostTrafficHook; hook != "" {
+		L.Info("invoking post-traffic hook", "hook", hook, "version", newVersion)
+
+		if err := invokeHook(L, hook, map[string]string{"app": app.App, "version": newVersion}); err != nil {
+			return errors.Wrap(err, "post-traffic hook")
+		}
+	}
+
+	return nil
+}
+
+// invokeHook synchronously invokes the Lambda function at arn with a
+// JSON-encoded payload, returning an error if the hook couldn't be
+// invoked or the hook itself errored. A no-op when arn is empty.
+func invokeHook(L hclog.Logger, arn string, payload interface{}) error {
+	if arn == "" {
+		return nil
+	}
+
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	out, err := lambda.New(sess).Invoke(&lambda.InvokeInput{
+		FunctionName: aws.String(arn),
+		Payload:      body,
+	})
+	if err != nil {
+		return err
+	}
+
+	if out.FunctionError != nil {
+		return fmt.Errorf("hook %s returned %s: %s", arn, *out.FunctionError, string(out.Payload))
+	}
+
+	return nil
+}
+
+func sumMetrics(cwSvc *cloudwatch.CloudWatch, fnName, version string, now time.Time) (float64, error) {
+	var total float64
+
+	for _, metric := range []string{"Errors", "Throttles"} {
+		out, err := cwSvc.GetMetricStatistics(&cloudwatch.GetMetricStatisticsInput{
+			Namespace:  aws.String("AWS/Lambda"),
+			MetricName: aws.String(metric),
+			Dimensions: []*cloudwatch.Dimension{
+				{Name: aws.String("FunctionName"), Value: aws.String(fnName)},
+				{Name: aws.String("Resource"), Value: aws.String(fmt.Sprintf("%s:%s", fnName, version))},
+			},
+			StartTime:  aws.Time(now.Add(-5 * time.Minute)),
+			EndTime:    aws.Time(now),
+			Period:     aws.Int64(300),
+			Statistics: []*string{aws.String("Sum")},
+		})
+		if err != nil {
+			return 0, err
+		}
+
+		for _, dp := range out.Datapoints {
+			total += aws.Float64Value(dp.Sum)
+		}
+	}
+
+	return total, nil
+}
+
+func (d *Deployer) trafficConfig() *TrafficConfig {
+	if d.config.Traffic == nil {
+		return &TrafficConfig{}
+	}
+	return d.config.Traffic
+}
+
+// Promote finalizes the alias to 100% on the version pending from the
+// last Deploy, ending a canary that was left for external promotion.
+func (d *Deployer) Promote(ctx context.Context, L hclog.Logger, app *component.Source, dep *LambdaDeployment) error {
+	lamSvc := lambda.New(sess)
+
+	L.Info("promoting canary", "alias", d.trafficConfig().alias(), "version", dep.PendingVersion)
+
+	_, err := lamSvc.UpdateAlias(&lambda.UpdateAliasInput{
+		FunctionName:    aws.String(app.App),
+		Name:            aws.String(d.trafficConfig().alias()),
+		FunctionVersion: aws.String(dep.PendingVersion),
+		RoutingConfig:   &lambda.AliasRoutingConfiguration{},
+	})
+
+	return err
+}
+
+func (d *Deployer) PromoteFunc() interface{} {
+	return d.Promote
+}
+
+// Rollback flips the alias back to the version that was live before the
+// deployment recorded in dep, undoing a promotion or abandoning a
+// canary entirely.
+func (d *Deployer) Rollback(ctx context.Context, L hclog.Logger, app *component.Source, dep *LambdaDeployment) error {
+	if dep.PreviousVersion == "" {
+		return fmt.Errorf("no previous version recorded for %s, nothing to roll back to", app.App)
+	}
+
+	lamSvc := lambda.New(sess)
+
+	L.Info("rolling back alias", "alias", d.trafficConfig().alias(), "version", dep.PreviousVersion)
+
+	_, err := lamSvc.UpdateAlias(&lambda.UpdateAliasInput{
+		FunctionName:    aws.String(app.App),
+		Name:            aws.String(d.trafficConfig().alias()),
+		FunctionVersion: aws.String(dep.PreviousVersion),
+		RoutingConfig:   &lambda.AliasRoutingConfiguration{},
+	})
+
+	return err
+}
+
+func (d *Deployer) RollbackFunc() interface{} {
+	return d.Rollback
+}
+
+var _ component.Promoter = (*Deployer)(nil)
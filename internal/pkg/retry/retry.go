@@ -0,0 +1,95 @@
+// Package retry implements a small Step Functions-style retry policy,
+// shared by every package in this platform that makes mutating AWS
+// calls and needs to tolerate eventual consistency, in-flight
+// conflicts, and throttling.
+package retry
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/hashicorp/go-hclog"
+)
+
+// Rule is one entry of a retry policy: if a call fails with an error
+// whose code is in ErrorEquals (and whose message contains
+// MessageContains, when set), it's retried up to MaxAttempts times with
+// the interval growing by BackoffRate each time.
+type Rule struct {
+	ErrorEquals []string `hcl:"error_equals"`
+
+	// MessageContains, when non-empty, additionally requires the
+	// error's message to contain this substring before the rule
+	// matches. Some AWS error codes are reused for both transient and
+	// permanent failures; this narrows a rule to the transient case.
+	MessageContains string `hcl:"message_contains,optional"`
+
+	IntervalSeconds int     `hcl:"interval_seconds,optional"`
+	MaxAttempts     int     `hcl:"max_attempts,optional"`
+	BackoffRate     float64 `hcl:"backoff_rate,optional"`
+}
+
+// Do calls fn, retrying it against rules whenever it fails with an
+// awserr.Error that matches a rule, up to that rule's MaxAttempts. The
+// nth retry waits IntervalSeconds * BackoffRate^(n-1), plus up to 25%
+// jitter, so concurrent callers don't retry in lockstep.
+func Do(L hclog.Logger, rules []Rule, fn func() error) error {
+	attempts := make([]int, len(rules))
+
+	for {
+		err := fn()
+		if err == nil {
+			return nil
+		}
+
+		awsErr, ok := err.(awserr.Error)
+		if !ok {
+			return err
+		}
+
+		idx, rule := match(rules, awsErr)
+		if rule == nil {
+			return err
+		}
+
+		attempts[idx]++
+		if attempts[idx] > rule.MaxAttempts {
+			return err
+		}
+
+		sleep := backoffDuration(*rule, attempts[idx])
+
+		L.Warn("retrying after transient AWS error", "code", awsErr.Code(), "attempt", attempts[idx], "max-attempts", rule.MaxAttempts, "sleep", sleep)
+
+		time.Sleep(sleep)
+	}
+}
+
+func match(rules []Rule, awsErr awserr.Error) (int, *Rule) {
+	for i, rule := range rules {
+		for _, want := range rule.ErrorEquals {
+			if want != awsErr.Code() {
+				continue
+			}
+
+			if rule.MessageContains != "" && !strings.Contains(awsErr.Message(), rule.MessageContains) {
+				continue
+			}
+
+			return i, &rules[i]
+		}
+	}
+
+	return -1, nil
+}
+
+func backoffDuration(rule Rule, attempt int) time.Duration {
+	interval := time.Duration(rule.IntervalSeconds) * time.Second
+	backoff := math.Pow(rule.BackoffRate, float64(attempt-1))
+	jitter := 1 + rand.Float64()*0.25
+
+	return time.Duration(float64(interval) * backoff * jitter)
+}
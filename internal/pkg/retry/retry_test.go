@@ -0,0 +1,162 @@
+package retry
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/hashicorp/go-hclog"
+)
+
+func TestDoRetriesMatchingErrorUntilSuccess(t *testing.T) {
+	rules := []Rule{
+		{ErrorEquals: []string{"Throttling"}, IntervalSeconds: 0, MaxAttempts: 3, BackoffRate: 1},
+	}
+
+	calls := 0
+	err := Do(hclog.NewNullLogger(), rules, func() error {
+		calls++
+		if calls < 3 {
+			return awserr.New("Throttling", "slow down", nil)
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Do returned %v, want nil", err)
+	}
+
+	if calls != 3 {
+		t.Errorf("calls = %d, want 3", calls)
+	}
+}
+
+func TestDoGivesUpAfterMaxAttempts(t *testing.T) {
+	rules := []Rule{
+		{ErrorEquals: []string{"Throttling"}, IntervalSeconds: 0, MaxAttempts: 2, BackoffRate: 1},
+	}
+
+	calls := 0
+	err := Do(hclog.NewNullLogger(), rules, func() error {
+		calls++
+		return awserr.New("Throttling", "slow down", nil)
+	})
+
+	if err == nil {
+		t.Fatalf("Do returned nil, want an error")
+	}
+
+	// One initial attempt plus MaxAttempts retries.
+	if calls != 3 {
+		t.Errorf("calls = %d, want 3", calls)
+	}
+}
+
+func TestDoDoesNotRetryUnmatchedCode(t *testing.T) {
+	rules := []Rule{
+		{ErrorEquals: []string{"Throttling"}, IntervalSeconds: 0, MaxAttempts: 5, BackoffRate: 1},
+	}
+
+	calls := 0
+	err := Do(hclog.NewNullLogger(), rules, func() error {
+		calls++
+		return awserr.New("AccessDenied", "nope", nil)
+	})
+
+	if err == nil {
+		t.Fatalf("Do returned nil, want an error")
+	}
+
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1 (no retries for an unmatched code)", calls)
+	}
+}
+
+func TestDoDoesNotRetryNonAWSError(t *testing.T) {
+	rules := []Rule{
+		{ErrorEquals: []string{"Throttling"}, IntervalSeconds: 0, MaxAttempts: 5, BackoffRate: 1},
+	}
+
+	calls := 0
+	err := Do(hclog.NewNullLogger(), rules, func() error {
+		calls++
+		return errPlain
+	})
+
+	if err != errPlain {
+		t.Fatalf("Do returned %v, want errPlain", err)
+	}
+
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1", calls)
+	}
+}
+
+func TestDoHonorsMessageContains(t *testing.T) {
+	rules := []Rule{
+		{
+			ErrorEquals:     []string{"InvalidParameterValueException"},
+			MessageContains: "cannot be assumed by Lambda",
+			IntervalSeconds: 0,
+			MaxAttempts:     3,
+			BackoffRate:     1,
+		},
+	}
+
+	// A permanent error that happens to share the same code but not the
+	// message should not be retried.
+	calls := 0
+	err := Do(hclog.NewNullLogger(), rules, func() error {
+		calls++
+		return awserr.New("InvalidParameterValueException", "Unsupported runtime", nil)
+	})
+
+	if err == nil {
+		t.Fatalf("Do returned nil, want an error")
+	}
+
+	if calls != 1 {
+		t.Errorf("calls = %d, want 1 (message doesn't match, shouldn't retry)", calls)
+	}
+
+	// The transient case, with the matching message, should retry.
+	calls = 0
+	err = Do(hclog.NewNullLogger(), rules, func() error {
+		calls++
+		if calls < 2 {
+			return awserr.New("InvalidParameterValueException", "The role defined for the function cannot be assumed by Lambda.", nil)
+		}
+		return nil
+	})
+
+	if err != nil {
+		t.Fatalf("Do returned %v, want nil", err)
+	}
+
+	if calls != 2 {
+		t.Errorf("calls = %d, want 2", calls)
+	}
+}
+
+func TestBackoffDurationGrowsByRate(t *testing.T) {
+	rule := Rule{IntervalSeconds: 2, BackoffRate: 2}
+
+	first := backoffDuration(rule, 1)
+	second := backoffDuration(rule, 2)
+
+	// Jitter adds up to 25%, so compare against the unjittered floor
+	// rather than asserting an exact value.
+	if first < 2*time.Second || first > 2*time.Second*5/4 {
+		t.Errorf("backoffDuration(attempt=1) = %v, want ~2s", first)
+	}
+
+	if second < 4*time.Second || second > 4*time.Second*5/4 {
+		t.Errorf("backoffDuration(attempt=2) = %v, want ~4s", second)
+	}
+}
+
+var errPlain = &plainError{"boom"}
+
+type plainError struct{ msg string }
+
+func (e *plainError) Error() string { return e.msg }